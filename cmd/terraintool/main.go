@@ -0,0 +1,100 @@
+// Command terraintool dumps a region-file chunk to a .nbt file and
+// re-imports an edited one, so level designers can hand-author chunks
+// in existing NBT editors and drop them into a running world.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/imclab/Legend-of-Adventure/server/terrain/nbt"
+	"github.com/imclab/Legend-of-Adventure/server/terrain/region"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "dump":
+		dump(os.Args[2:])
+	case "import":
+		importChunk(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: terraintool dump <region-dir> <world> <cx> <cy> <out.nbt>")
+	fmt.Fprintln(os.Stderr, "       terraintool import <region-dir> <world> <cx> <cy> <in.nbt>")
+	os.Exit(1)
+}
+
+func dump(args []string) {
+	if len(args) != 5 {
+		usage()
+	}
+	regionDir, world := args[0], args[1]
+	cx, cy := atoi(args[2]), atoi(args[3])
+	out := args[4]
+
+	store := region.NewRegionStore(regionDir)
+	t, ok, err := store.Load(world, cx, cy)
+	if err != nil {
+		fatal(err)
+	}
+	if !ok {
+		fatal(fmt.Errorf("no chunk at (%d,%d) in %s", cx, cy, world))
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		fatal(err)
+	}
+	defer f.Close()
+
+	if err := nbt.Export(t, f); err != nil {
+		fatal(err)
+	}
+}
+
+func importChunk(args []string) {
+	if len(args) != 5 {
+		usage()
+	}
+	regionDir, world := args[0], args[1]
+	cx, cy := atoi(args[2]), atoi(args[3])
+	in := args[4]
+
+	f, err := os.Open(in)
+	if err != nil {
+		fatal(err)
+	}
+	defer f.Close()
+
+	t, err := nbt.Import(f)
+	if err != nil {
+		fatal(err)
+	}
+
+	store := region.NewRegionStore(regionDir)
+	if err := store.Save(world, cx, cy, t); err != nil {
+		fatal(err)
+	}
+}
+
+func atoi(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		fatal(fmt.Errorf("not a number: %q", s))
+	}
+	return n
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "terraintool:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,154 @@
+package terrain
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// deltaRingSize bounds how many individual tile mutations a Terrain
+// remembers. A briefly disconnected client can resync from anywhere in
+// this window; older history is dropped and forces a full snapshot.
+const deltaRingSize = 256
+
+// versionCounterBits is how many low bits of a snapshot version are the
+// per-mutation counter; the remaining high bits are a per-instance
+// epoch (see newEpoch). 2^40 mutations is far more than any one process
+// will ever apply to a single chunk, so the counter can't run into the
+// epoch bits above it.
+const versionCounterBits = 40
+const versionCounterMask = uint64(1)<<versionCounterBits - 1
+
+var epochCounter uint64
+
+// newEpoch returns a value with only its high (non-counter) bits set,
+// unique enough per deltaRing that a version carrying a different
+// epoch can never be mistaken for one this ring actually issued. That
+// matters because deltaRing.version always restarts from an epoch, not
+// zero: a client that remembers a version from a previous process (or a
+// different Terrain instance entirely, e.g. after a region-store
+// reload) must be told to resync with a full snapshot, not silently
+// "you're already caught up" just because the low bits happen to compare
+// as greater-or-equal.
+func newEpoch() uint64 {
+	n := atomic.AddUint64(&epochCounter, 1)
+	seed := uint64(time.Now().UnixNano()) ^ (n * 0x9E3779B97F4A7C15)
+	return seed &^ versionCounterMask
+}
+
+// Cell is a single mutated tile within a Delta.
+type Cell struct {
+	X     int
+	Y     int
+	Tile  uint
+	Solid bool
+}
+
+// Delta describes the tiles that changed in a Terrain since some prior
+// SnapshotVersion. Full is set when the caller's version has already
+// aged out of the retained history, meaning it must fall back to a full
+// snapshot (e.g. PackedTerrain.String()) instead of applying Changes.
+type Delta struct {
+	Version uint64
+	Changes []Cell
+	Full    bool
+}
+
+// deltaRing is a fixed-size ring buffer of single-cell mutations, used
+// to answer DiffSince without resending the whole chunk on every tile
+// change (destructible walls, placed items, opened doors). Its mutex
+// also guards the owning Terrain's Tiles/Hitmap, since every write to
+// them goes through Mutate alongside a ring entry - readers that walk
+// the grid (Terrain.String, Terrain.Pack) take the same lock so
+// they never observe a tile and its delta record out of sync.
+type deltaRing struct {
+	mu      sync.RWMutex
+	version uint64
+	entries [deltaRingSize]Delta
+	count   int
+	next    int
+}
+
+func newDeltaRing() *deltaRing {
+	return &deltaRing{version: newEpoch()}
+}
+
+// Mutate changes the tile at (x, y) and records it as a new Delta so
+// subscribers can be sent an incremental update instead of a resnapshot.
+func (self *Terrain) Mutate(x, y int, tile uint, solid bool) {
+	d := self.deltas
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	self.Tiles[x][y] = tile
+	self.Hitmap[x][y] = solid
+
+	d.version++
+	d.entries[d.next] = Delta{
+		Version: d.version,
+		Changes: []Cell{{X: x, Y: y, Tile: tile, Solid: solid}},
+	}
+	d.next = (d.next + 1) % deltaRingSize
+	if d.count < deltaRingSize {
+		d.count++
+	}
+}
+
+// SnapshotVersion returns the version a fresh full snapshot represents.
+// A subscriber should record this alongside the snapshot it receives so
+// it can later call DiffSince with it.
+func (self *Terrain) SnapshotVersion() uint64 {
+	d := self.deltas
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.version
+}
+
+// DiffSince collapses every mutation after version into one Delta,
+// keeping only the latest change per cell. It returns Delta{Full: true}
+// instead, telling the caller to request a full snapshot, whenever
+// version belongs to a different epoch than this Terrain's current
+// ring (e.g. it's from before a process restart) or has already fallen
+// out of the retained ring.
+func (self *Terrain) DiffSince(version uint64) Delta {
+	d := self.deltas
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if version&^versionCounterMask != d.version&^versionCounterMask {
+		return Delta{Version: d.version, Full: true}
+	}
+
+	if d.count == 0 || version >= d.version {
+		return Delta{Version: d.version}
+	}
+
+	oldest := (d.next - d.count + deltaRingSize) % deltaRingSize
+	oldestVersion := d.entries[oldest].Version
+	if version < oldestVersion-1 {
+		return Delta{Version: d.version, Full: true}
+	}
+
+	latest := make(map[[2]int]Cell)
+	order := make([][2]int, 0, d.count)
+	for i := 0; i < d.count; i++ {
+		entry := d.entries[(oldest+i)%deltaRingSize]
+		if entry.Version <= version {
+			continue
+		}
+		for _, c := range entry.Changes {
+			key := [2]int{c.X, c.Y}
+			if _, ok := latest[key]; !ok {
+				order = append(order, key)
+			}
+			latest[key] = c
+		}
+	}
+
+	changes := make([]Cell, len(order))
+	for i, key := range order {
+		changes[i] = latest[key]
+	}
+
+	return Delta{Version: d.version, Changes: changes}
+}
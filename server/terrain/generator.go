@@ -0,0 +1,338 @@
+package terrain
+
+import "fmt"
+
+// Tile ids produced by the generator. Values below TileGrass are
+// reserved for hand-authored/legacy content that predates the
+// generator.
+const (
+	TileGrass uint = iota + 100
+	TileForest
+	TileDesert
+	TileWater
+	TileMountain
+	TileGemVein
+	TileChest
+	TileLockedChest
+	TileKey
+	TileHealthPotion
+)
+
+// salts distinguish otherwise-identical hash64 calls made for different
+// purposes within the same chunk, so e.g. elevation noise and moisture
+// noise don't accidentally correlate.
+const (
+	saltElevation int64 = iota + 1
+	saltMoisture
+	saltFeatures
+	saltDungeon
+)
+
+// GeneratorConfig tunes the noise octaves, biome thresholds and feature
+// density used by Generator. DefaultGeneratorConfig returns sensible
+// starting values.
+type GeneratorConfig struct {
+	Octaves     int
+	Persistence float64
+	Scale       float64
+
+	WaterLevel     float64
+	MountainLevel  float64
+	DesertMoisture float64
+	ForestMoisture float64
+
+	GemVeinDensity       float64
+	ChestDensity         float64
+	PotionDensity        float64
+	DungeonPortalDensity float64
+}
+
+// DefaultGeneratorConfig returns the generator's default tuning.
+func DefaultGeneratorConfig() GeneratorConfig {
+	return GeneratorConfig{
+		Octaves:     4,
+		Persistence: 0.5,
+		Scale:       0.05,
+
+		WaterLevel:     -0.3,
+		MountainLevel:  0.5,
+		DesertMoisture: -0.2,
+		ForestMoisture: 0.3,
+
+		GemVeinDensity:       0.15,
+		ChestDensity:         0.1,
+		PotionDensity:        0.02,
+		DungeonPortalDensity: 0.05,
+	}
+}
+
+// Generator deterministically builds terrain chunks from a world seed:
+// the same (seed, world, cx, cy) always yields the same tiles, hitmap
+// and portals, regardless of visit order or process restarts.
+type Generator struct {
+	Seed   int64
+	Config GeneratorConfig
+
+	// Graph, if set, receives every dungeon portal this Generator places
+	// so the game can resolve it and its paired return portal through
+	// PortalGraph instead of an opaque Destination string.
+	Graph *PortalGraph
+}
+
+// NewGenerator creates a Generator for the given world seed.
+func NewGenerator(seed int64, config GeneratorConfig) *Generator {
+	return &Generator{Seed: seed, Config: config}
+}
+
+// Generate builds the chunk at (cx, cy) in world: a first pass lays down
+// biomes from layered value noise, then a second pass seeds quest
+// features (locked chests and their keys, potion caches, gem veins) and
+// any dungeon portal, using a per-chunk RNG so placement is stable.
+func (self *Generator) Generate(world string, height, width, cx, cy int) *Terrain {
+	t := NewTerrain(world, height, width, cx, cy)
+	worldHash := hashString(world)
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			wx, wy := cx*width+x, cy*height+y
+			elevation := self.noise(wx, wy, worldHash, saltElevation)
+			moisture := self.noise(wx, wy, worldHash, saltMoisture)
+			tile, solid := self.biome(elevation, moisture)
+			t.Tiles[x][y] = tile
+			t.Hitmap[x][y] = solid
+		}
+	}
+
+	self.placeFeatures(t, world, worldHash, cx, cy)
+	return t
+}
+
+func (self *Generator) biome(elevation, moisture float64) (tile uint, solid bool) {
+	cfg := self.Config
+	switch {
+	case elevation < cfg.WaterLevel:
+		return TileWater, true
+	case elevation > cfg.MountainLevel:
+		return TileMountain, true
+	case moisture < cfg.DesertMoisture:
+		return TileDesert, false
+	case moisture > cfg.ForestMoisture:
+		return TileForest, false
+	default:
+		return TileGrass, false
+	}
+}
+
+// noise samples fractal value noise at world coordinates (x, y): several
+// octaves of smoothNoise at increasing frequency and decreasing
+// amplitude, normalized back into roughly [-1, 1]. worldHash keys the
+// lattice to a specific world so two worlds sharing a Generator don't
+// produce identical terrain at the same coordinates.
+func (self *Generator) noise(x, y int, worldHash, salt int64) float64 {
+	var total, amplitude, maxAmp float64
+	amplitude = 1
+	frequency := self.Config.Scale
+
+	for o := 0; o < self.Config.Octaves; o++ {
+		lattice := hash64(self.Seed, worldHash, salt, int64(o))
+		total += smoothNoise(float64(x)*frequency, float64(y)*frequency, lattice) * amplitude
+		maxAmp += amplitude
+		amplitude *= self.Config.Persistence
+		frequency *= 2
+	}
+
+	if maxAmp == 0 {
+		return 0
+	}
+	return total / maxAmp
+}
+
+// placeFeatures runs the quest-feature pass over an already-generated
+// chunk: it seeds a chunk-local RNG from the world seed, world hash and
+// chunk coordinates (so placement never depends on visit order, and two
+// worlds never collide) and scatters gem veins, a locked chest with its
+// key, potion caches and a dungeon portal accordingly.
+func (self *Generator) placeFeatures(t *Terrain, world string, worldHash int64, cx, cy int) {
+	rng := newChunkRNG(self.Seed, worldHash, cx, cy, saltFeatures)
+	cfg := self.Config
+
+	var mountainCells, openCells [][2]int
+	for x := 0; x < t.Width; x++ {
+		for y := 0; y < t.Height; y++ {
+			switch t.Tiles[x][y] {
+			case TileMountain:
+				mountainCells = append(mountainCells, [2]int{x, y})
+			case TileGrass, TileForest:
+				openCells = append(openCells, [2]int{x, y})
+			}
+		}
+	}
+
+	for _, cell := range mountainCells {
+		if rng.Float64() < cfg.GemVeinDensity {
+			t.Tiles[cell[0]][cell[1]] = TileGemVein
+		}
+	}
+
+	claimed := make(map[[2]int]bool)
+
+	var keyID string
+	if len(openCells) >= 2 && rng.Float64() < cfg.ChestDensity {
+		chestIdx := rng.Intn(len(openCells))
+		chest := openCells[chestIdx]
+
+		remaining := make([][2]int, 0, len(openCells)-1)
+		remaining = append(remaining, openCells[:chestIdx]...)
+		remaining = append(remaining, openCells[chestIdx+1:]...)
+		key := remaining[rng.Intn(len(remaining))]
+
+		keyID = fmt.Sprintf("key-%d-%d-%d-%d", cx, cy, key[0], key[1])
+		t.Tiles[chest[0]][chest[1]] = TileLockedChest
+		t.Tiles[key[0]][key[1]] = TileKey
+		claimed[chest] = true
+		claimed[key] = true
+	}
+
+	for _, cell := range openCells {
+		if claimed[cell] {
+			continue
+		}
+		if rng.Float64() < cfg.PotionDensity {
+			t.Tiles[cell[0]][cell[1]] = TileHealthPotion
+			claimed[cell] = true
+		}
+	}
+
+	if len(openCells) > 0 && rng.Float64() < cfg.DungeonPortalDensity {
+		cell := openCells[rng.Intn(len(openCells))]
+		dungeonID := hash64(self.Seed, worldHash, int64(cx), int64(cy), saltDungeon)
+		dungeonWorld := fmt.Sprintf("dungeon-%x", dungeonID)
+
+		entrance := &Portal{
+			X:            cell[0],
+			Y:            cell[1],
+			Width:        1,
+			Height:       1,
+			RequiredItem: keyID,
+		}
+
+		if self.Graph != nil {
+			// Spawn the paired return portal at the dungeon's own
+			// entry point, the center of the dungeon's first chunk,
+			// so walking back through it always drops the player at
+			// this entrance in the parent world.
+			spawnX, spawnY := float(t.Width/2), float(t.Height/2)
+			self.Graph.LinkDungeon(world, entrance, dungeonWorld, spawnX, spawnY)
+		} else {
+			entrance.Kind = PortalDungeonEntrance
+			entrance.Destination = dungeonWorld
+		}
+
+		t.Portals = append(t.Portals, *entrance)
+	}
+}
+
+// smoothNoise samples 2D value noise at (x, y): integer lattice points
+// are hashed to pseudo-random values and interpolated with a smoothstep
+// easing curve so the result is continuous.
+func smoothNoise(x, y float64, seed uint64) float64 {
+	x0, y0 := floor(x), floor(y)
+	x1, y1 := x0+1, y0+1
+
+	sx, sy := smoothstep(x-x0), smoothstep(y-y0)
+
+	n00 := latticeValue(int64(x0), int64(y0), seed)
+	n10 := latticeValue(int64(x1), int64(y0), seed)
+	n01 := latticeValue(int64(x0), int64(y1), seed)
+	n11 := latticeValue(int64(x1), int64(y1), seed)
+
+	ix0 := lerp(n00, n10, sx)
+	ix1 := lerp(n01, n11, sx)
+	return lerp(ix0, ix1, sy)
+}
+
+func floor(v float64) float64 {
+	i := int64(v)
+	if v < 0 && float64(i) != v {
+		i--
+	}
+	return float64(i)
+}
+
+func smoothstep(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
+
+func lerp(a, b, t float64) float64 {
+	return a + t*(b-a)
+}
+
+// latticeValue returns a deterministic pseudo-random value in [-1, 1]
+// for an integer lattice point, mixed with seed.
+func latticeValue(x, y int64, seed uint64) float64 {
+	h := hash64v(seed, uint64(x), uint64(y))
+	return float64(h%1000001)/500000.0 - 1
+}
+
+// hash64 deterministically mixes a handful of int64s into one uint64,
+// used to seed both the noise lattice and per-chunk feature RNG so that
+// (seed, world, x, y) always produces the same chunk.
+func hash64(parts ...int64) uint64 {
+	var h uint64 = 1469598103934665603 // FNV-1a offset basis with its last digit dropped
+	for _, p := range parts {
+		h ^= uint64(p)
+		h *= 1099511628211 // FNV-1a prime
+		h ^= h >> 33
+	}
+	return h
+}
+
+// hashString reduces a world name to an int64 deterministically, so it
+// can be mixed into hash64 alongside the numeric seed and coordinates.
+func hashString(s string) int64 {
+	var h uint64 = 1469598103934665603 // FNV-1a offset basis with its last digit dropped
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211 // FNV-1a prime
+	}
+	return int64(h)
+}
+
+func hash64v(parts ...uint64) uint64 {
+	var h uint64 = 1469598103934665603
+	for _, p := range parts {
+		h ^= p
+		h *= 1099511628211
+		h ^= h >> 33
+	}
+	return h
+}
+
+// chunkRNG is a tiny splitmix64-based PRNG seeded once per chunk so
+// feature placement is reproducible independent of generation order.
+type chunkRNG struct {
+	state uint64
+}
+
+func newChunkRNG(seed, worldHash int64, cx, cy int, pass int64) *chunkRNG {
+	return &chunkRNG{state: hash64(seed, worldHash, int64(cx), int64(cy), pass)}
+}
+
+func (self *chunkRNG) next() uint64 {
+	self.state += 0x9E3779B97F4A7C15
+	z := self.state
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
+
+func (self *chunkRNG) Float64() float64 {
+	return float64(self.next()%1000000) / 1000000.0
+}
+
+func (self *chunkRNG) Intn(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	return int(self.next() % uint64(n))
+}
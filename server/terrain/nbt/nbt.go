@@ -0,0 +1,491 @@
+// Package nbt reads and writes terrain chunks in a Minecraft-style NBT
+// format, so level designers can hand-author chunks in existing NBT
+// editors and drop them into a running world via cmd/terraintool.
+package nbt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/imclab/Legend-of-Adventure/server/terrain"
+)
+
+// NBT tag ids, per the Minecraft NBT spec.
+const (
+	tagEnd byte = iota
+	tagByte
+	tagShort
+	tagInt
+	tagLong
+	tagFloat
+	tagDouble
+	tagByteArray
+	tagString
+	tagList
+	tagCompound
+	tagIntArray
+	tagLongArray
+)
+
+// tileNames maps generator tile ids to stable string names so exported
+// chunks stay meaningful (and re-importable) even if numeric tile ids
+// are renumbered later.
+var tileNames = map[uint]string{
+	terrain.TileGrass:        "legend:grass",
+	terrain.TileForest:       "legend:forest",
+	terrain.TileDesert:       "legend:desert",
+	terrain.TileWater:        "legend:water",
+	terrain.TileMountain:     "legend:mountain",
+	terrain.TileGemVein:      "legend:gem_vein",
+	terrain.TileChest:        "legend:chest",
+	terrain.TileLockedChest:  "legend:locked_chest",
+	terrain.TileKey:          "legend:key",
+	terrain.TileHealthPotion: "legend:health_potion",
+}
+
+var tileIDs = func() map[string]uint {
+	out := make(map[string]uint, len(tileNames))
+	for id, name := range tileNames {
+		out[name] = id
+	}
+	return out
+}()
+
+func tileName(id uint) string {
+	if name, ok := tileNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("legend:unknown_%d", id)
+}
+
+func tileID(name string) (uint, error) {
+	if id, ok := tileIDs[name]; ok {
+		return id, nil
+	}
+	var id uint
+	if n, err := fmt.Sscanf(name, "legend:unknown_%d", &id); n != 1 || err != nil {
+		return 0, fmt.Errorf("nbt: unrecognized tile name %q", name)
+	}
+	return id, nil
+}
+
+// Export writes t to w as a root NBT compound: Width/Height/X/Y, a
+// Palette of tile-name strings, a BlockStates LongArray bit-packed per
+// the palette (see terrain.PackedTerrain), a Hitmap ByteArray bitset,
+// and a Portals list of compounds.
+func Export(t *terrain.Terrain, w io.Writer) error {
+	packed := t.Pack()
+	bw := &writer{w: w}
+
+	bw.tag(tagCompound, "")
+
+	bw.intTag("Width", int32(t.Width))
+	bw.intTag("Height", int32(t.Height))
+	bw.intTag("X", int32(t.X))
+	bw.intTag("Y", int32(t.Y))
+	bw.intTag("Bits", int32(packed.Bits))
+
+	bw.listHeader("Palette", tagString, len(packed.Palette))
+	for _, tile := range packed.Palette {
+		bw.rawString(tileName(tile))
+	}
+
+	bw.longArrayTag("BlockStates", packed.Data)
+	bw.byteArrayTag("Hitmap", packed.Hitmap)
+
+	bw.listHeader("Portals", tagCompound, len(t.Portals))
+	for _, p := range t.Portals {
+		bw.writePortal(p)
+	}
+
+	bw.writeByte(tagEnd) // close root compound
+
+	return bw.err
+}
+
+func (self *writer) writePortal(p terrain.Portal) {
+	self.intTag("X", int32(p.X))
+	self.intTag("Y", int32(p.Y))
+	self.intTag("Width", int32(p.Width))
+	self.intTag("Height", int32(p.Height))
+	self.stringTag("World", p.World)
+	self.stringTag("Destination", p.Destination)
+	self.floatTag("DestinationX", float32(p.DestinationX))
+	self.floatTag("DestinationY", float32(p.DestinationY))
+	self.intTag("Kind", int32(p.Kind))
+	if p.OneWay {
+		self.byteTag("OneWay", 1)
+	} else {
+		self.byteTag("OneWay", 0)
+	}
+	self.stringTag("RequiredItem", p.RequiredItem)
+	self.writeByte(tagEnd) // close this portal compound
+}
+
+// Import reads a chunk previously written by Export.
+func Import(r io.Reader) (*terrain.Terrain, error) {
+	br := &reader{r: r}
+
+	rootTag, _ := br.tagName()
+	if rootTag != tagCompound {
+		return nil, errors.New("nbt: expected a root compound tag")
+	}
+
+	var width, height, x, y int
+	var bits uint
+	var palette []uint
+	var data []uint64
+	var hitmap []byte
+	var portals []terrain.Portal
+
+	for {
+		tag, name := br.tagName()
+		if br.err != nil {
+			return nil, br.err
+		}
+		if tag == tagEnd {
+			break
+		}
+		switch name {
+		case "Width":
+			width = int(br.int32())
+		case "Height":
+			height = int(br.int32())
+		case "X":
+			x = int(br.int32())
+		case "Y":
+			y = int(br.int32())
+		case "Bits":
+			bits = uint(br.int32())
+		case "Palette":
+			elem := br.readByte()
+			count := int(br.int32())
+			palette = make([]uint, count)
+			for i := range palette {
+				if elem != tagString {
+					return nil, errors.New("nbt: Palette must be a string list")
+				}
+				id, err := tileID(br.rawString())
+				if err != nil {
+					return nil, err
+				}
+				palette[i] = id
+			}
+		case "BlockStates":
+			count := int(br.int32())
+			data = make([]uint64, count)
+			for i := range data {
+				data[i] = uint64(br.int64())
+			}
+		case "Hitmap":
+			count := int(br.int32())
+			hitmap = make([]byte, count)
+			if br.err == nil {
+				_, br.err = io.ReadFull(r, hitmap)
+			}
+		case "Portals":
+			elem := br.readByte()
+			count := int(br.int32())
+			portals = make([]terrain.Portal, count)
+			for i := range portals {
+				if elem != tagCompound {
+					return nil, errors.New("nbt: Portals must be a compound list")
+				}
+				portals[i] = br.readPortal()
+			}
+		default:
+			br.skip(tag)
+		}
+	}
+
+	if br.err != nil {
+		return nil, br.err
+	}
+	if bits == 0 {
+		return nil, errors.New("nbt: missing or zero Bits tag")
+	}
+	cells := width * height
+	perWord := 64 / int(bits)
+	if len(data) < (cells+perWord-1)/perWord {
+		return nil, errors.New("nbt: BlockStates is smaller than Width*Height*Bits requires")
+	}
+	if len(hitmap) < (cells+7)/8 {
+		return nil, errors.New("nbt: Hitmap is smaller than Width*Height requires")
+	}
+
+	t := terrain.NewTerrain("", height, width, x, y)
+	packed := &terrain.PackedTerrain{
+		Height: height, Width: width, X: x, Y: y,
+		Palette: palette, Bits: bits, Data: data, Hitmap: hitmap,
+	}
+	for cx := 0; cx < width; cx++ {
+		for cy := 0; cy < height; cy++ {
+			t.Tiles[cx][cy] = packed.Get(cx, cy)
+		}
+	}
+	cell := 0
+	for cx := 0; cx < width; cx++ {
+		for cy := 0; cy < height; cy++ {
+			t.Hitmap[cx][cy] = hitmap[cell/8]&(1<<uint(cell%8)) != 0
+			cell++
+		}
+	}
+	t.Portals = portals
+
+	return t, nil
+}
+
+func (self *reader) readPortal() terrain.Portal {
+	var p terrain.Portal
+	for {
+		tag, name := self.tagName()
+		if tag == tagEnd || self.err != nil {
+			break
+		}
+		switch name {
+		case "X":
+			p.X = int(self.int32())
+		case "Y":
+			p.Y = int(self.int32())
+		case "Width":
+			p.Width = int(self.int32())
+		case "Height":
+			p.Height = int(self.int32())
+		case "World":
+			p.World = self.rawString()
+		case "Destination":
+			p.Destination = self.rawString()
+		case "DestinationX":
+			p.DestinationX = float(self.float32())
+		case "DestinationY":
+			p.DestinationY = float(self.float32())
+		case "Kind":
+			p.Kind = terrain.PortalKind(self.int32())
+		case "OneWay":
+			p.OneWay = self.readByte() != 0
+		case "RequiredItem":
+			p.RequiredItem = self.rawString()
+		default:
+			self.skip(tag)
+		}
+	}
+	return p
+}
+
+// writer is a tiny big-endian NBT encoder; it records the first error it
+// hits and becomes a no-op afterward, so callers only need to check err
+// once at the end.
+type writer struct {
+	w   io.Writer
+	err error
+}
+
+func (self *writer) writeByte(b byte) {
+	if self.err != nil {
+		return
+	}
+	_, self.err = self.w.Write([]byte{b})
+}
+
+func (self *writer) writeUint16(v uint16) {
+	if self.err != nil {
+		return
+	}
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	_, self.err = self.w.Write(b[:])
+}
+
+func (self *writer) writeInt32(v int32) {
+	if self.err != nil {
+		return
+	}
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(v))
+	_, self.err = self.w.Write(b[:])
+}
+
+func (self *writer) writeInt64(v int64) {
+	if self.err != nil {
+		return
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	_, self.err = self.w.Write(b[:])
+}
+
+func (self *writer) rawString(s string) {
+	self.writeUint16(uint16(len(s)))
+	if self.err != nil {
+		return
+	}
+	_, self.err = io.WriteString(self.w, s)
+}
+
+func (self *writer) tag(t byte, name string) {
+	self.writeByte(t)
+	self.rawString(name)
+}
+
+func (self *writer) listHeader(name string, elem byte, count int) {
+	self.tag(tagList, name)
+	self.writeByte(elem)
+	self.writeInt32(int32(count))
+}
+
+func (self *writer) intTag(name string, v int32) {
+	self.tag(tagInt, name)
+	self.writeInt32(v)
+}
+
+func (self *writer) byteTag(name string, v byte) {
+	self.tag(tagByte, name)
+	self.writeByte(v)
+}
+
+func (self *writer) floatTag(name string, v float32) {
+	self.tag(tagFloat, name)
+	self.writeInt32(int32(math.Float32bits(v)))
+}
+
+func (self *writer) stringTag(name, v string) {
+	self.tag(tagString, name)
+	self.rawString(v)
+}
+
+func (self *writer) byteArrayTag(name string, data []byte) {
+	self.tag(tagByteArray, name)
+	self.writeInt32(int32(len(data)))
+	if self.err != nil {
+		return
+	}
+	_, self.err = self.w.Write(data)
+}
+
+func (self *writer) longArrayTag(name string, data []uint64) {
+	self.tag(tagLongArray, name)
+	self.writeInt32(int32(len(data)))
+	for _, v := range data {
+		self.writeInt64(int64(v))
+	}
+}
+
+// reader is the writer's counterpart: it records the first error it
+// hits and returns zero values afterward.
+type reader struct {
+	r   io.Reader
+	err error
+}
+
+func (self *reader) readByte() byte {
+	if self.err != nil {
+		return 0
+	}
+	var b [1]byte
+	_, self.err = io.ReadFull(self.r, b[:])
+	return b[0]
+}
+
+func (self *reader) uint16() uint16 {
+	if self.err != nil {
+		return 0
+	}
+	var b [2]byte
+	_, self.err = io.ReadFull(self.r, b[:])
+	return binary.BigEndian.Uint16(b[:])
+}
+
+func (self *reader) int32() int32 {
+	if self.err != nil {
+		return 0
+	}
+	var b [4]byte
+	_, self.err = io.ReadFull(self.r, b[:])
+	return int32(binary.BigEndian.Uint32(b[:]))
+}
+
+func (self *reader) int64() int64 {
+	if self.err != nil {
+		return 0
+	}
+	var b [8]byte
+	_, self.err = io.ReadFull(self.r, b[:])
+	return int64(binary.BigEndian.Uint64(b[:]))
+}
+
+func (self *reader) float32() float32 {
+	return math.Float32frombits(uint32(self.int32()))
+}
+
+func (self *reader) rawString() string {
+	n := self.uint16()
+	if self.err != nil || n == 0 {
+		return ""
+	}
+	buf := make([]byte, n)
+	_, self.err = io.ReadFull(self.r, buf)
+	return string(buf)
+}
+
+func (self *reader) tagName() (tag byte, name string) {
+	tag = self.readByte()
+	if tag == tagEnd || self.err != nil {
+		return tag, ""
+	}
+	return tag, self.rawString()
+}
+
+// skip discards a tag's payload without interpreting it, so Import can
+// tolerate fields it doesn't recognize (forward compatibility for
+// hand-edited NBT files).
+func (self *reader) skip(tag byte) {
+	switch tag {
+	case tagByte:
+		self.readByte()
+	case tagShort:
+		self.uint16()
+	case tagInt:
+		self.int32()
+	case tagLong:
+		self.int64()
+	case tagFloat:
+		self.int32()
+	case tagDouble:
+		self.int64()
+	case tagByteArray:
+		n := self.int32()
+		buf := make([]byte, n)
+		if self.err == nil {
+			_, self.err = io.ReadFull(self.r, buf)
+		}
+	case tagString:
+		self.rawString()
+	case tagList:
+		elem := self.readByte()
+		n := self.int32()
+		for i := int32(0); i < n; i++ {
+			self.skip(elem)
+		}
+	case tagCompound:
+		for {
+			t, _ := self.tagName()
+			if t == tagEnd || self.err != nil {
+				return
+			}
+			self.skip(t)
+		}
+	case tagIntArray:
+		n := self.int32()
+		for i := int32(0); i < n; i++ {
+			self.int32()
+		}
+	case tagLongArray:
+		n := self.int32()
+		for i := int32(0); i < n; i++ {
+			self.int64()
+		}
+	}
+}
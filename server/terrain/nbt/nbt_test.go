@@ -0,0 +1,92 @@
+package nbt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/imclab/Legend-of-Adventure/server/terrain"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	want := terrain.NewTerrain("overworld", 4, 4, 2, 3)
+	want.Tiles[0][0] = terrain.TileWater
+	want.Tiles[1][1] = terrain.TileLockedChest
+	want.Hitmap[0][0] = true
+	want.Portals = append(want.Portals, terrain.Portal{
+		X: 1, Y: 1, Width: 1, Height: 1,
+		World:        "overworld",
+		Destination:  "dungeon-abc",
+		DestinationX: 5,
+		DestinationY: 6,
+		Kind:         terrain.PortalDungeonEntrance,
+		RequiredItem: "key-1",
+	})
+
+	var buf bytes.Buffer
+	if err := Export(want, &buf); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	got, err := Import(&buf)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	if got.Width != want.Width || got.Height != want.Height || got.X != want.X || got.Y != want.Y {
+		t.Fatalf("dimensions = %+v, want %+v", got, want)
+	}
+	for x := range want.Tiles {
+		for y := range want.Tiles[x] {
+			if got.Tiles[x][y] != want.Tiles[x][y] {
+				t.Fatalf("Tiles[%d][%d] = %d, want %d", x, y, got.Tiles[x][y], want.Tiles[x][y])
+			}
+			if got.Hitmap[x][y] != want.Hitmap[x][y] {
+				t.Fatalf("Hitmap[%d][%d] = %v, want %v", x, y, got.Hitmap[x][y], want.Hitmap[x][y])
+			}
+		}
+	}
+
+	if len(got.Portals) != 1 {
+		t.Fatalf("len(Portals) = %d, want 1", len(got.Portals))
+	}
+	gotPortal, wantPortal := got.Portals[0], want.Portals[0]
+	if gotPortal.World != wantPortal.World {
+		t.Fatalf("Portal.World = %q, want %q", gotPortal.World, wantPortal.World)
+	}
+	if gotPortal.Destination != wantPortal.Destination {
+		t.Fatalf("Portal.Destination = %q, want %q", gotPortal.Destination, wantPortal.Destination)
+	}
+	if gotPortal.DestinationX != wantPortal.DestinationX || gotPortal.DestinationY != wantPortal.DestinationY {
+		t.Fatalf("Portal destination = (%v,%v), want (%v,%v)", gotPortal.DestinationX, gotPortal.DestinationY, wantPortal.DestinationX, wantPortal.DestinationY)
+	}
+	if gotPortal.Kind != wantPortal.Kind {
+		t.Fatalf("Portal.Kind = %v, want %v", gotPortal.Kind, wantPortal.Kind)
+	}
+	if gotPortal.RequiredItem != wantPortal.RequiredItem {
+		t.Fatalf("Portal.RequiredItem = %q, want %q", gotPortal.RequiredItem, wantPortal.RequiredItem)
+	}
+}
+
+func TestImportRejectsUnrecognizedPaletteEntry(t *testing.T) {
+	terr := terrain.NewTerrain("w", 1, 1, 0, 0)
+	terr.Tiles[0][0] = terrain.TileGrass
+
+	var buf bytes.Buffer
+	if err := Export(terr, &buf); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	// The replacement must be the same byte length as "legend:grass" -
+	// rawString is a length-prefixed NBT string, so changing the length
+	// without updating the prefix would corrupt parsing entirely rather
+	// than exercising the unrecognized-tile-name path this test wants.
+	raw := buf.Bytes()
+	corrupted := bytes.Replace(raw, []byte("legend:grass"), []byte("legend:xyz12"), 1)
+	if bytes.Equal(raw, corrupted) {
+		t.Fatal("test setup failed to corrupt the palette entry")
+	}
+
+	if _, err := Import(bytes.NewReader(corrupted)); err == nil {
+		t.Fatal("Import accepted an unrecognized tile name")
+	}
+}
@@ -0,0 +1,210 @@
+package terrain
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"strconv"
+)
+
+// PackedTerrain is a bit-packed, palette-indexed encoding of a Terrain
+// chunk's tile grid, modeled on Minecraft's chunk BitStorage. It trades
+// the verbosity of Terrain.String()'s array-of-arrays JSON for a payload
+// sized to the number of distinct tiles actually present in the chunk.
+type PackedTerrain struct {
+	Height int
+	Width  int
+	X      int
+	Y      int
+
+	Palette []uint
+	Bits    uint
+	Data    []uint64
+	Hitmap  []byte // 1 bit per cell, column by column (cell x*Height+y), packed low-bit-first
+}
+
+// Pack builds a PackedTerrain snapshot of t, computing the smallest
+// palette and bit width that can represent every tile currently on the
+// grid. Values are packed index-by-index into 64-bit words; a value is
+// never split across a word boundary, so the tail bits of a word are
+// left unused rather than straddling into the next one.
+func (self *Terrain) Pack() *PackedTerrain {
+	self.deltas.mu.RLock()
+	defer self.deltas.mu.RUnlock()
+
+	palette := make([]uint, 0, 16)
+	index := make(map[uint]uint)
+
+	for x := range self.Tiles {
+		for y := range self.Tiles[x] {
+			tile := self.Tiles[x][y]
+			if _, ok := index[tile]; !ok {
+				index[tile] = uint(len(palette))
+				palette = append(palette, tile)
+			}
+		}
+	}
+
+	bits := bitsFor(len(palette))
+	perWord := int(64 / bits)
+	cells := self.Width * self.Height
+
+	packed := &PackedTerrain{
+		Height:  self.Height,
+		Width:   self.Width,
+		X:       self.X,
+		Y:       self.Y,
+		Palette: palette,
+		Bits:    bits,
+		Data:    make([]uint64, 0, (cells+perWord-1)/perWord),
+		Hitmap:  make([]byte, (cells+7)/8),
+	}
+
+	var word uint64
+	var used uint
+	cell := 0
+	for x := range self.Tiles {
+		for y := range self.Tiles[x] {
+			if used+bits > 64 {
+				packed.Data = append(packed.Data, word)
+				word, used = 0, 0
+			}
+			word |= uint64(index[self.Tiles[x][y]]) << used
+			used += bits
+
+			if self.Hitmap[x][y] {
+				packed.Hitmap[cell/8] |= 1 << uint(cell%8)
+			}
+			cell++
+		}
+	}
+	if used > 0 {
+		packed.Data = append(packed.Data, word)
+	}
+
+	return packed
+}
+
+// bitsFor returns the number of bits needed to index a palette of n
+// distinct values, never less than 1.
+func bitsFor(n int) uint {
+	if n <= 1 {
+		return 1
+	}
+	return uint(math.Ceil(math.Log2(float64(n))))
+}
+
+func (self *PackedTerrain) perWord() int {
+	return int(64 / self.Bits)
+}
+
+func (self *PackedTerrain) cellIndex(x, y int) int {
+	return x*self.Height + y
+}
+
+// Get returns the tile id at (x, y), resolved through the palette.
+func (self *PackedTerrain) Get(x, y int) uint {
+	idx := self.cellIndex(x, y)
+	perWord := self.perWord()
+	shift := uint(idx%perWord) * self.Bits
+	mask := uint64(1)<<self.Bits - 1
+	word := self.Data[idx/perWord]
+	return self.Palette[(word>>shift)&mask]
+}
+
+// Set writes v at (x, y), growing the palette (and, if necessary, the
+// bit width of every packed word) when v hasn't been seen before.
+func (self *PackedTerrain) Set(x, y int, v uint) {
+	paletteIndex := -1
+	for i, tile := range self.Palette {
+		if tile == v {
+			paletteIndex = i
+			break
+		}
+	}
+	if paletteIndex == -1 {
+		self.Palette = append(self.Palette, v)
+		paletteIndex = len(self.Palette) - 1
+		if newBits := bitsFor(len(self.Palette)); newBits != self.Bits {
+			self.regrow(newBits)
+		}
+	}
+
+	idx := self.cellIndex(x, y)
+	perWord := self.perWord()
+	shift := uint(idx%perWord) * self.Bits
+	mask := uint64(1)<<self.Bits - 1
+	word := idx / perWord
+	self.Data[word] = (self.Data[word] &^ (mask << shift)) | (uint64(paletteIndex) << shift)
+}
+
+// regrow repacks Data at a wider bit width after the palette has grown
+// past what the current width can index.
+func (self *PackedTerrain) regrow(bits uint) {
+	cells := self.Width * self.Height
+	oldPerWord := self.perWord()
+	oldMask := uint64(1)<<self.Bits - 1
+
+	values := make([]uint, cells)
+	for i := 0; i < cells; i++ {
+		shift := uint(i%oldPerWord) * self.Bits
+		values[i] = uint((self.Data[i/oldPerWord] >> shift) & oldMask)
+	}
+
+	self.Bits = bits
+	perWord := self.perWord()
+	data := make([]uint64, 0, (cells+perWord-1)/perWord)
+
+	var word uint64
+	var used uint
+	for _, v := range values {
+		if used+bits > 64 {
+			data = append(data, word)
+			word, used = 0, 0
+		}
+		word |= uint64(v) << used
+		used += bits
+	}
+	if used > 0 {
+		data = append(data, word)
+	}
+	self.Data = data
+}
+
+// String renders the compact wire format: a palette of distinct tile
+// ids, the bit width they're packed at, the packed data and hitmap as
+// base64. This is what the websocket layer should send instead of
+// Terrain.String()'s array-of-arrays JSON; that legacy format is still
+// available from Terrain.String() for clients that haven't switched over.
+func (self *PackedTerrain) String() string {
+	rawData := make([]byte, len(self.Data)*8)
+	for i, word := range self.Data {
+		binary.LittleEndian.PutUint64(rawData[i*8:], word)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("{\"palette\":[")
+	for i, tile := range self.Palette {
+		if i != 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(strconv.FormatUint(uint64(tile), 10))
+	}
+	buf.WriteString("],\"bits\":")
+	buf.WriteString(strconv.FormatUint(uint64(self.Bits), 10))
+	buf.WriteString(",\"data\":\"")
+	buf.WriteString(base64.StdEncoding.EncodeToString(rawData))
+	buf.WriteString("\",\"hitmap\":\"")
+	buf.WriteString(base64.StdEncoding.EncodeToString(self.Hitmap))
+	buf.WriteString("\",\"h\":")
+	buf.WriteString(strconv.Itoa(self.Height))
+	buf.WriteString(",\"w\":")
+	buf.WriteString(strconv.Itoa(self.Width))
+	buf.WriteString(",\"x\":")
+	buf.WriteString(strconv.Itoa(self.X))
+	buf.WriteString(",\"y\":")
+	buf.WriteString(strconv.Itoa(self.Y))
+	buf.WriteString("}")
+	return buf.String()
+}
@@ -0,0 +1,76 @@
+package terrain
+
+import "testing"
+
+func TestPackGetRoundTrip(t *testing.T) {
+	tiles := [][]uint{
+		{TileGrass, TileForest, TileWater, TileMountain},
+		{TileGrass, TileGrass, TileGemVein, TileKey},
+	}
+	terr := NewTerrain("w", len(tiles[0]), len(tiles), 0, 0)
+	for x := range tiles {
+		for y := range tiles[x] {
+			terr.Tiles[x][y] = tiles[x][y]
+			terr.Hitmap[x][y] = (x+y)%2 == 0
+		}
+	}
+
+	packed := terr.Pack()
+	for x := range tiles {
+		for y := range tiles[x] {
+			if got, want := packed.Get(x, y), tiles[x][y]; got != want {
+				t.Fatalf("Get(%d,%d) = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestPackedSetGrowsBitsWhenPaletteOverflows(t *testing.T) {
+	terr := NewTerrain("w", 1, 2, 0, 0)
+	terr.Tiles[0][0] = TileGrass
+	terr.Tiles[1][0] = TileForest
+	packed := terr.Pack()
+
+	if packed.Bits != 1 {
+		t.Fatalf("Bits = %d, want 1 for a 2-value palette", packed.Bits)
+	}
+
+	// Pushing a third and fourth distinct value should force a regrow
+	// past 1 bit, and every previously-set cell must still read back
+	// correctly afterward.
+	packed.Set(0, 0, TileWater)
+	packed.Set(1, 0, TileMountain)
+
+	if packed.Bits < 2 {
+		t.Fatalf("Bits = %d after 4-value palette, want >= 2", packed.Bits)
+	}
+	if got := packed.Get(0, 0); got != TileWater {
+		t.Fatalf("Get(0,0) = %d after regrow, want %d", got, TileWater)
+	}
+	if got := packed.Get(1, 0); got != TileMountain {
+		t.Fatalf("Get(1,0) = %d after regrow, want %d", got, TileMountain)
+	}
+}
+
+func TestPackedSetOverwritesExistingPaletteEntry(t *testing.T) {
+	terr := NewTerrain("w", 1, 2, 0, 0)
+	terr.Tiles[0][0] = TileGrass
+	terr.Tiles[1][0] = TileForest
+	packed := terr.Pack()
+
+	packed.Set(0, 0, TileForest)
+	if got := packed.Get(0, 0); got != TileForest {
+		t.Fatalf("Get(0,0) = %d, want %d", got, TileForest)
+	}
+	if got := packed.Get(1, 0); got != TileForest {
+		t.Fatalf("Get(1,0) = %d, want %d (unaffected by Set at a different cell)", got, TileForest)
+	}
+}
+
+func TestBitsForNeverReturnsZero(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 4, 5, 16, 17} {
+		if bits := bitsFor(n); bits < 1 {
+			t.Fatalf("bitsFor(%d) = %d, want >= 1", n, bits)
+		}
+	}
+}
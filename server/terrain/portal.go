@@ -0,0 +1,109 @@
+package terrain
+
+import (
+	"fmt"
+	"sync"
+)
+
+// PortalKind classifies what a Portal connects to, so code besides the
+// raw Destination string can reason about its behavior - in particular,
+// whether a return portal should be created automatically.
+type PortalKind int
+
+const (
+	PortalDungeonEntrance PortalKind = iota
+	PortalDungeonExit
+	PortalTownWarp
+	PortalQuestWarp
+)
+
+func (self PortalKind) String() string {
+	switch self {
+	case PortalDungeonEntrance:
+		return "dungeon-entrance"
+	case PortalDungeonExit:
+		return "dungeon-exit"
+	case PortalTownWarp:
+		return "town-warp"
+	case PortalQuestWarp:
+		return "quest-warp"
+	default:
+		return "unknown"
+	}
+}
+
+// PortalGraph models portals as a directed graph keyed by source world,
+// rather than leaving every caller to parse opaque Destination strings.
+// It's the source of truth for "what portals exist in this world" and
+// for resolving a portal to where it actually leads.
+type PortalGraph struct {
+	mu      sync.Mutex
+	byWorld map[string][]*Portal
+}
+
+// NewPortalGraph creates an empty graph.
+func NewPortalGraph() *PortalGraph {
+	return &PortalGraph{byWorld: make(map[string][]*Portal)}
+}
+
+// Add registers p as living in world. It takes the address of the
+// caller's Portal so later mutations (e.g. unlocking it) are visible
+// through the graph without a separate update call.
+func (self *PortalGraph) Add(world string, p *Portal) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	p.World = world
+	self.byWorld[world] = append(self.byWorld[world], p)
+}
+
+// PortalsFrom returns every portal known to originate in world, as the
+// same pointers the graph holds internally - not copies - so callers
+// can update one in place (e.g. clearing RequiredItem once a quest item
+// is picked up) and have that reflected the next time it's resolved.
+func (self *PortalGraph) PortalsFrom(world string) []*Portal {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	out := make([]*Portal, len(self.byWorld[world]))
+	copy(out, self.byWorld[world])
+	return out
+}
+
+// Resolve returns where p leads. A locked portal (RequiredItem set)
+// fails to resolve until the caller clears that requirement, e.g. by
+// updating the Portal in place once the quest item has been picked up.
+func (self *PortalGraph) Resolve(p Portal) (destWorld string, destX, destY float, err error) {
+	if p.RequiredItem != "" {
+		return "", 0, 0, fmt.Errorf("portal at (%d,%d) in %s is locked: requires %s", p.X, p.Y, p.World, p.RequiredItem)
+	}
+	return p.Destination, p.DestinationX, p.DestinationY, nil
+}
+
+// LinkDungeon registers a dungeon-entrance portal placed in parentWorld
+// together with its paired dungeon-exit portal at the given spawn tile
+// in dungeonWorld, so the dungeon's chunk is generated with a way back
+// to exactly where the player came from. Both portals are two-way
+// unless the caller flips OneWay afterward (e.g. for a one-shot quest
+// warp that collapses behind the player).
+func (self *PortalGraph) LinkDungeon(parentWorld string, entrance *Portal, dungeonWorld string, spawnX, spawnY float) *Portal {
+	entrance.Kind = PortalDungeonEntrance
+	entrance.Destination = dungeonWorld
+	entrance.DestinationX = spawnX
+	entrance.DestinationY = spawnY
+	entrance.OneWay = false
+	self.Add(parentWorld, entrance)
+
+	exit := &Portal{
+		X:            int(spawnX),
+		Y:            int(spawnY),
+		Width:        entrance.Width,
+		Height:       entrance.Height,
+		Destination:  parentWorld,
+		DestinationX: float(entrance.X),
+		DestinationY: float(entrance.Y),
+		Kind:         PortalDungeonExit,
+		OneWay:       false,
+	}
+	self.Add(dungeonWorld, exit)
+	return exit
+}
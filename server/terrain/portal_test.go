@@ -0,0 +1,77 @@
+package terrain
+
+import "testing"
+
+func TestPortalGraphAddSetsWorld(t *testing.T) {
+	graph := NewPortalGraph()
+	p := &Portal{X: 1, Y: 2}
+	graph.Add("overworld", p)
+
+	if p.World != "overworld" {
+		t.Fatalf("p.World = %q, want %q", p.World, "overworld")
+	}
+}
+
+func TestPortalsFromReturnsLivePointers(t *testing.T) {
+	graph := NewPortalGraph()
+	graph.Add("overworld", &Portal{X: 1, Y: 2, RequiredItem: "key-1"})
+
+	from := graph.PortalsFrom("overworld")
+	if len(from) != 1 {
+		t.Fatalf("len(PortalsFrom) = %d, want 1", len(from))
+	}
+	from[0].RequiredItem = ""
+
+	again := graph.PortalsFrom("overworld")
+	if again[0].RequiredItem != "" {
+		t.Fatalf("RequiredItem = %q after clearing it through a prior PortalsFrom result, want empty", again[0].RequiredItem)
+	}
+}
+
+func TestResolveRejectsLockedPortal(t *testing.T) {
+	graph := NewPortalGraph()
+	p := Portal{X: 1, Y: 2, World: "overworld", RequiredItem: "key-1", Destination: "dungeon-1"}
+
+	if _, _, _, err := graph.Resolve(p); err == nil {
+		t.Fatal("Resolve succeeded for a locked portal")
+	}
+
+	p.RequiredItem = ""
+	dest, _, _, err := graph.Resolve(p)
+	if err != nil {
+		t.Fatalf("Resolve failed for an unlocked portal: %v", err)
+	}
+	if dest != "dungeon-1" {
+		t.Fatalf("dest = %q, want %q", dest, "dungeon-1")
+	}
+}
+
+func TestLinkDungeonRegistersPairedPortals(t *testing.T) {
+	graph := NewPortalGraph()
+	entrance := &Portal{X: 3, Y: 4, Width: 1, Height: 1}
+
+	exit := graph.LinkDungeon("overworld", entrance, "dungeon-abc", 8, 9)
+
+	if entrance.Kind != PortalDungeonEntrance {
+		t.Fatalf("entrance.Kind = %v, want %v", entrance.Kind, PortalDungeonEntrance)
+	}
+	if entrance.Destination != "dungeon-abc" || entrance.DestinationX != 8 || entrance.DestinationY != 9 {
+		t.Fatalf("entrance does not point at the dungeon spawn: %+v", entrance)
+	}
+
+	if exit.Kind != PortalDungeonExit {
+		t.Fatalf("exit.Kind = %v, want %v", exit.Kind, PortalDungeonExit)
+	}
+	if exit.Destination != "overworld" || exit.DestinationX != float(entrance.X) || exit.DestinationY != float(entrance.Y) {
+		t.Fatalf("exit does not point back at the entrance: %+v", exit)
+	}
+
+	fromOverworld := graph.PortalsFrom("overworld")
+	if len(fromOverworld) != 1 || fromOverworld[0] != entrance {
+		t.Fatalf("overworld portals = %+v, want just the entrance", fromOverworld)
+	}
+	fromDungeon := graph.PortalsFrom("dungeon-abc")
+	if len(fromDungeon) != 1 || fromDungeon[0] != exit {
+		t.Fatalf("dungeon portals = %+v, want just the exit", fromDungeon)
+	}
+}
@@ -0,0 +1,420 @@
+// Package region persists terrain chunks to disk in region-file
+// containers, à la gomcmap/Minecraft's Anvil format: chunks are grouped
+// 32x32 into a region, and a region is one file holding a fixed-size
+// offset/length header followed by zlib-compressed chunk payloads.
+package region
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/imclab/Legend-of-Adventure/server/terrain"
+)
+
+// regionSize is the number of chunks along one side of a region.
+const regionSize = 32
+
+// headerEntries is the number of chunk slots in a region's header.
+const headerEntries = regionSize * regionSize
+
+// headerEntrySize is the on-disk size, in bytes, of one header entry:
+// an 8-byte offset and a 4-byte length.
+const headerEntrySize = 12
+
+const headerSize = headerEntries * headerEntrySize
+
+// RegionStore loads and saves *terrain.Terrain chunks from region files
+// rooted at a base directory, one subdirectory per world.
+type RegionStore struct {
+	baseDir string
+
+	mu      sync.Mutex
+	regions map[string]*regionFile
+	dirty   map[string]dirtyChunk
+
+	stop chan struct{}
+}
+
+type dirtyChunk struct {
+	world  string
+	cx, cy int
+	t      *terrain.Terrain
+}
+
+// NewRegionStore creates a store rooted at baseDir. The directory tree
+// is created lazily as worlds and regions are written.
+func NewRegionStore(baseDir string) *RegionStore {
+	return &RegionStore{
+		baseDir: baseDir,
+		regions: make(map[string]*regionFile),
+		dirty:   make(map[string]dirtyChunk),
+	}
+}
+
+// Load returns the chunk at (cx, cy) in world, if it has ever been
+// saved. The second return value is false if no such chunk exists yet.
+func (self *RegionStore) Load(world string, cx, cy int) (*terrain.Terrain, bool, error) {
+	rf, err := self.openRegion(world, cx, cy, false)
+	if err != nil {
+		return nil, false, err
+	}
+	if rf == nil {
+		return nil, false, nil
+	}
+	return rf.load(localX(cx), localY(cy))
+}
+
+// Save writes t to disk immediately as the chunk at (cx, cy) in world.
+func (self *RegionStore) Save(world string, cx, cy int, t *terrain.Terrain) error {
+	rf, err := self.openRegion(world, cx, cy, true)
+	if err != nil {
+		return err
+	}
+	return rf.save(localX(cx), localY(cy), t)
+}
+
+// MarkDirty records that t should be written out on the next flush,
+// without blocking on disk IO now. Call this from chunk-mutation paths
+// (broken tiles, placed objects) instead of Save directly.
+func (self *RegionStore) MarkDirty(world string, cx, cy int, t *terrain.Terrain) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.dirty[dirtyKey(world, cx, cy)] = dirtyChunk{world: world, cx: cx, cy: cy, t: t}
+}
+
+// Flush writes every chunk marked dirty since the last flush.
+func (self *RegionStore) Flush() error {
+	self.mu.Lock()
+	pending := self.dirty
+	self.dirty = make(map[string]dirtyChunk)
+	self.mu.Unlock()
+
+	for _, d := range pending {
+		if err := self.Save(d.world, d.cx, d.cy, d.t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartFlusher runs Flush on a timer until Stop is called.
+func (self *RegionStore) StartFlusher(interval time.Duration) {
+	self.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				self.Flush()
+			case <-self.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the background flusher started by StartFlusher.
+func (self *RegionStore) Stop() {
+	if self.stop != nil {
+		close(self.stop)
+		self.stop = nil
+	}
+}
+
+func dirtyKey(world string, cx, cy int) string {
+	rx, ry := cx>>5, cy>>5
+	return fmt.Sprintf("%s/%d,%d/%d,%d", world, rx, ry, cx, cy)
+}
+
+func localX(cx int) int {
+	return ((cx % regionSize) + regionSize) % regionSize
+}
+
+func localY(cy int) int {
+	return ((cy % regionSize) + regionSize) % regionSize
+}
+
+// openRegion returns the regionFile covering (cx, cy) in world, opening
+// or creating it on disk as needed. If create is false and the region
+// file doesn't exist yet, it returns (nil, nil).
+func (self *RegionStore) openRegion(world string, cx, cy int, create bool) (*regionFile, error) {
+	rx, ry := cx>>5, cy>>5
+	key := fmt.Sprintf("%s/%d,%d", world, rx, ry)
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if rf, ok := self.regions[key]; ok {
+		return rf, nil
+	}
+
+	dir := filepath.Join(self.baseDir, world)
+	path := filepath.Join(dir, fmt.Sprintf("r.%d.%d.region", rx, ry))
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if !create {
+			return nil, nil
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	rf, err := openRegionFile(path)
+	if err != nil {
+		return nil, err
+	}
+	self.regions[key] = rf
+	return rf, nil
+}
+
+// regionFile is a single region's backing file: a header of chunk
+// offset/length entries followed by zlib-compressed chunk payloads.
+// Entries that have been superseded by a relocated (grown) chunk leave
+// a gap tracked in free, so the space isn't leaked.
+type regionFile struct {
+	mu   sync.Mutex
+	path string
+
+	header [headerEntries]regionEntry
+	free   []span
+	size   int64 // current file length
+}
+
+type regionEntry struct {
+	offset int64
+	length int64
+}
+
+type span struct {
+	offset int64
+	length int64
+}
+
+// used is an occupied span within a region file, as recorded by a
+// header entry; it exists only so rebuildFreeList can sort occupied
+// ranges before diffing them into gaps.
+type used struct {
+	offset int64
+	length int64
+}
+
+func openRegionFile(path string) (*regionFile, error) {
+	rf := &regionFile{path: path, size: headerSize}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() == 0 {
+		if _, err := f.Write(make([]byte, headerSize)); err != nil {
+			return nil, err
+		}
+		return rf, nil
+	}
+
+	raw := make([]byte, headerSize)
+	if _, err := io.ReadFull(f, raw); err != nil {
+		return nil, err
+	}
+	for i := 0; i < headerEntries; i++ {
+		b := raw[i*headerEntrySize:]
+		rf.header[i] = regionEntry{
+			offset: int64(binary.BigEndian.Uint64(b[0:8])),
+			length: int64(binary.BigEndian.Uint32(b[8:12])),
+		}
+	}
+	rf.size = info.Size()
+	rf.rebuildFreeList()
+	return rf, nil
+}
+
+// rebuildFreeList derives the gaps between occupied spans (and between
+// the header and file end) so newly-grown chunks can reuse them instead
+// of always appending to the end of the file.
+func (self *regionFile) rebuildFreeList() {
+	var occupied []used
+	for _, e := range self.header {
+		if e.length > 0 {
+			occupied = append(occupied, used{e.offset, e.length})
+		}
+	}
+	sortUsed(occupied)
+
+	self.free = self.free[:0]
+	cursor := int64(headerSize)
+	for _, u := range occupied {
+		if u.offset > cursor {
+			self.free = append(self.free, span{cursor, u.offset - cursor})
+		}
+		cursor = u.offset + u.length
+	}
+	if cursor < self.size {
+		self.free = append(self.free, span{cursor, self.size - cursor})
+	}
+}
+
+func sortUsed(s []used) {
+	for i := 1; i < len(s); i++ {
+		for j := i; j > 0 && s[j-1].offset > s[j].offset; j-- {
+			s[j-1], s[j] = s[j], s[j-1]
+		}
+	}
+}
+
+func (self *regionFile) load(lx, ly int) (*terrain.Terrain, bool, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	entry := self.header[ly*regionSize+lx]
+	if entry.length == 0 {
+		return nil, false, nil
+	}
+
+	f, err := os.Open(self.path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, entry.length)
+	if _, err := f.ReadAt(buf, entry.offset); err != nil {
+		return nil, false, err
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, false, err
+	}
+	defer zr.Close()
+
+	var payload chunkPayload
+	if err := gob.NewDecoder(zr).Decode(&payload); err != nil {
+		return nil, false, err
+	}
+
+	return payload.toTerrain(), true, nil
+}
+
+func (self *regionFile) save(lx, ly int, t *terrain.Terrain) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if err := gob.NewEncoder(zw).Encode(newChunkPayload(t)); err != nil {
+		zw.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	payload := compressed.Bytes()
+
+	idx := ly*regionSize + lx
+	old := self.header[idx]
+
+	offset, needsRebuild := self.allocate(idx, old, int64(len(payload)))
+
+	f, err := os.OpenFile(self.path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteAt(payload, offset); err != nil {
+		return err
+	}
+
+	self.header[idx] = regionEntry{offset: offset, length: int64(len(payload))}
+	if err := self.writeHeaderEntry(f, idx); err != nil {
+		return err
+	}
+	if needsRebuild {
+		self.rebuildFreeList()
+	}
+	return nil
+}
+
+// allocate picks a byte offset for a chunk payload of the given size,
+// preferring its previous slot if it still fits, then the first free
+// span large enough, then the end of the file. It reports whether the
+// free list needs to be rebuilt afterward: not just when the chunk
+// moved or grew past the end of the file, but also when it shrank
+// within its previous slot, since that leaves a reclaimable gap behind
+// the new, shorter entry.
+func (self *regionFile) allocate(idx int, old regionEntry, size int64) (int64, bool) {
+	if old.length >= size && old.length > 0 {
+		return old.offset, old.length > size
+	}
+
+	for i, s := range self.free {
+		if s.length >= size {
+			self.free = append(self.free[:i], self.free[i+1:]...)
+			if old.length > 0 {
+				self.free = append(self.free, span{old.offset, old.length})
+			}
+			return s.offset, true
+		}
+	}
+
+	offset := self.size
+	self.size += size
+	return offset, old.length > 0
+}
+
+func (self *regionFile) writeHeaderEntry(f *os.File, idx int) error {
+	entry := self.header[idx]
+	b := make([]byte, headerEntrySize)
+	binary.BigEndian.PutUint64(b[0:8], uint64(entry.offset))
+	binary.BigEndian.PutUint32(b[8:12], uint32(entry.length))
+	_, err := f.WriteAt(b, int64(idx*headerEntrySize))
+	return err
+}
+
+// chunkPayload is the gob-encoded form of a terrain chunk stored in a
+// region file; it mirrors terrain.Terrain's fields directly rather than
+// depending on the compact wire format, which is free to evolve
+// independently of on-disk storage.
+type chunkPayload struct {
+	Height, Width, X, Y int
+	Tiles               [][]uint
+	Hitmap              [][]bool
+	Portals             []terrain.Portal
+}
+
+func newChunkPayload(t *terrain.Terrain) chunkPayload {
+	return chunkPayload{
+		Height:  t.Height,
+		Width:   t.Width,
+		X:       t.X,
+		Y:       t.Y,
+		Tiles:   t.Tiles,
+		Hitmap:  t.Hitmap,
+		Portals: t.Portals,
+	}
+}
+
+func (self chunkPayload) toTerrain() *terrain.Terrain {
+	t := terrain.NewTerrain("", self.Height, self.Width, self.X, self.Y)
+	t.Tiles = self.Tiles
+	t.Hitmap = self.Hitmap
+	t.Portals = self.Portals
+	return t
+}
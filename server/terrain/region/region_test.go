@@ -0,0 +1,126 @@
+package region
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/imclab/Legend-of-Adventure/server/terrain"
+)
+
+func TestRegionStoreSaveLoadRoundTrip(t *testing.T) {
+	dir, err := os.MkdirTemp("", "region-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewRegionStore(dir)
+
+	want := terrain.NewTerrain("w", 4, 4, 2, 3)
+	want.Tiles[1][2] = 42
+
+	if err := store.Save("w", 2, 3, want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := store.Load("w", 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Load reported no chunk at (2,3) right after Save")
+	}
+	if got.Tiles[1][2] != 42 {
+		t.Fatalf("Tiles[1][2] = %d, want 42", got.Tiles[1][2])
+	}
+	if got.Height != want.Height || got.Width != want.Width {
+		t.Fatalf("dimensions = %dx%d, want %dx%d", got.Width, got.Height, want.Width, want.Height)
+	}
+}
+
+func TestRegionStoreLoadMissingChunk(t *testing.T) {
+	dir, err := os.MkdirTemp("", "region-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewRegionStore(dir)
+	_, ok, err := store.Load("w", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("Load reported a chunk existing in a freshly created store")
+	}
+}
+
+// TestRegionFileGrowShrinkReclaimsSpace exercises allocate's three
+// branches against one on-disk region: a large chunk is first appended
+// at the end of the file, then shrinks within its slot (so the slack
+// left behind must be reclaimable), and a later chunk reuses that
+// reclaimed span instead of appending to the end of the file forever.
+func TestRegionFileGrowShrinkReclaimsSpace(t *testing.T) {
+	dir, err := os.MkdirTemp("", "region-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewRegionStore(dir)
+
+	big := terrain.NewTerrain("w", 64, 64, 0, 0)
+	for x := range big.Tiles {
+		for y := range big.Tiles[x] {
+			big.Tiles[x][y] = uint(x*64 + y)
+		}
+	}
+	if err := store.Save("w", 0, 0, big); err != nil {
+		t.Fatal(err)
+	}
+
+	small := terrain.NewTerrain("w", 1, 1, 0, 0)
+	if err := store.Save("w", 0, 0, small); err != nil {
+		t.Fatal(err)
+	}
+
+	sizeAfterShrink, err := regionFileSize(dir, "w", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := terrain.NewTerrain("w", 64, 64, 0, 1)
+	if err := store.Save("w", 0, 1, other); err != nil {
+		t.Fatal(err)
+	}
+
+	sizeAfterReuse, err := regionFileSize(dir, "w", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sizeAfterReuse != sizeAfterShrink {
+		t.Fatalf("region file grew from %d to %d bytes placing a chunk that should fit in the space the shrink just freed",
+			sizeAfterShrink, sizeAfterReuse)
+	}
+
+	got, ok, err := store.Load("w", 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Load reported no chunk at (0,1) right after Save")
+	}
+	if got.Tiles[10][20] != other.Tiles[10][20] {
+		t.Fatalf("Tiles[10][20] = %d, want %d", got.Tiles[10][20], other.Tiles[10][20])
+	}
+}
+
+func regionFileSize(dir, world string, rx, ry int) (int64, error) {
+	path := dir + "/" + world + "/r." + strconv.Itoa(rx) + "." + strconv.Itoa(ry) + ".region"
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -10,6 +10,9 @@ type Terrain struct {
     Y int
 	Tiles  [][]uint
 	Hitmap [][]bool
+	Portals []Portal
+
+	deltas *deltaRing
 }
 
 type Portal struct {
@@ -20,6 +23,11 @@ type Portal struct {
     Destination string
     DestinationX float
     DestinationY float
+
+    World string
+    Kind PortalKind
+    OneWay bool
+    RequiredItem string
 }
 
 func NewTerrain(world string, height, width, x, y int) *Terrain {
@@ -37,10 +45,14 @@ func NewTerrain(world string, height, width, x, y int) *Terrain {
     terrain.Width = width
     terrain.X = x
     terrain.Y = y
+    terrain.deltas = newDeltaRing()
     return terrain
 }
 
 func (self *Terrain) String() string {
+    self.deltas.mu.RLock()
+    defer self.deltas.mu.RUnlock()
+
     var buf bytes.Buffer
     buf.WriteString("\"level\": [")
     for colno := range self.Tiles {